@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+// TestBlockScopeShadowing covers `x := 1; if true { x := 2 }; x`, which
+// must evaluate to 1 through both backends: the inner `x := 2` shadows the
+// outer x for the if-branch's block only, then stops shadowing once the
+// block ends. The compiler used to define every block's bindings straight
+// into the enclosing function's SymbolTable instead of a table of the
+// block's own, so the inner x permanently overwrote the outer one's slot
+// and the VM returned 2 here instead of 1.
+func TestBlockScopeShadowing(t *testing.T) {
+	node := blockNode{exprs: []astNode{
+		assignLocal(ident("x"), num(1)),
+		ifExprNode{
+			cond: booleanNode{payload: true},
+			branches: []ifBranch{
+				{
+					target: booleanNode{payload: true},
+					body: blockNode{exprs: []astNode{
+						assignLocal(ident("x"), num(2)),
+					}},
+				},
+			},
+		},
+		ident("x"),
+	}}
+
+	ast, vm, astErr, vmErr := evalBoth(t, node)
+	if astErr != nil {
+		t.Fatalf("AST eval: unexpected error: %s", astErr)
+	}
+	if vmErr != nil {
+		t.Fatalf("VM eval: unexpected error: %s", vmErr)
+	}
+
+	want := IntValue(1)
+	if !ast.Eq(want) {
+		t.Fatalf("AST eval = %s, want %s", ast.String(), want.String())
+	}
+	if !vm.Eq(want) {
+		t.Fatalf("VM eval = %s, want %s (the inner block's x must shadow, not overwrite, the outer x)", vm.String(), want.String())
+	}
+}
+
+// TestBlockScopeNestedFunctionClosure is a narrower regression check for the
+// same fix: a function body is itself compiled as a block, so closures
+// defined inside a block (rather than directly in a function's top-level
+// body) must still capture the enclosing function's locals as free
+// variables rather than being misidentified as sharing its frame.
+func TestBlockScopeNestedFunctionClosure(t *testing.T) {
+	// fn outer(n) {
+	//   adder := fn(m) { n + m }
+	//   adder(5)
+	// }
+	// outer(10)
+	outer := fnNode{
+		name: "outer",
+		args: []string{"n"},
+		body: blockNode{exprs: []astNode{
+			assignLocal(ident("adder"), fnNode{
+				args: []string{"m"},
+				body: binaryNode{op: "+", left: ident("n"), right: ident("m")},
+			}),
+			fnCallNode{fn: ident("adder"), args: []astNode{num(5)}},
+		}},
+	}
+
+	node := blockNode{exprs: []astNode{
+		assignLocal(ident("outer"), outer),
+		fnCallNode{fn: ident("outer"), args: []astNode{num(10)}},
+	}}
+
+	ast, vm, astErr, vmErr := evalBoth(t, node)
+	if astErr != nil {
+		t.Fatalf("AST eval: unexpected error: %s", astErr)
+	}
+	if vmErr != nil {
+		t.Fatalf("VM eval: unexpected error: %s", vmErr)
+	}
+
+	want := IntValue(15)
+	if !ast.Eq(want) {
+		t.Fatalf("AST eval = %s, want %s", ast.String(), want.String())
+	}
+	if !vm.Eq(want) {
+		t.Fatalf("VM eval = %s, want %s", vm.String(), want.String())
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import "fmt"
+
+// Op is a single VM instruction opcode. Most opcodes are followed by a fixed
+// number of operand bytes, encoded big-endian, as documented per-opcode below.
+type Op byte
+
+const (
+	OpConstant Op = iota // 2 operand bytes: index into the constant pool
+	OpNull               // push the interned null value
+	OpPop                // pop and discard the top of stack
+	OpDup                // push a second copy of the top of stack
+	OpSwap               // swap the top two stack values
+
+	OpGetLocal  // 1 operand byte: local slot index
+	OpSetLocal  // 1 operand byte: local slot index
+	OpGetGlobal // 2 operand bytes: global slot index
+	OpSetGlobal // 2 operand bytes: global slot index
+	OpGetFree   // 1 operand byte: free variable index in the current closure
+
+	OpMakeList   // 2 operand bytes: element count; pops that many values off the stack
+	OpMakeObject // 2 operand bytes: entry count; pops 2x that many values (key, value, ...) off the stack
+	OpGetProp    // pops (target, key), pushes the resolved property or null
+	OpSetProp    // pops (target, key, value), pushes value back
+
+	OpAssertType // 1 operand byte: listTypeTag or objectTypeTag; peeks TOS, errors if it isn't that type
+	OpListTail   // 2 operand bytes: starting index; pops a list, pushes the ListValue of its elements from that index on (empty if the index is past the end)
+	OpAssert     // 2 operand bytes: constant index of an error message string; pops a bool, erroring with that message if it's false
+
+	OpClosure     // 2 operand bytes: constant index of the CompiledFunction, 1 operand byte: free variable count
+	OpCall        // 1 operand byte: argument count
+	OpReturn      // return the top of stack to the caller
+	OpJump        // 2 operand bytes: absolute instruction pointer to jump to
+	OpJumpIfFalse // 2 operand bytes: absolute instruction pointer; pops a bool (erroring on any other type) and jumps there if it's false
+
+	OpUnary  // 1 operand byte: unaryOp
+	OpBinary // 1 operand byte: binaryOp
+
+	OpImport // 2 operand bytes: constant index of the module name string
+)
+
+// listTypeTag and objectTypeTag are the OpAssertType operand values, naming
+// the two assignment targets (list/object destructuring) that require their
+// right-hand side to be a specific type before picking it apart.
+const (
+	listTypeTag byte = iota
+	objectTypeTag
+)
+
+// unaryOpCodes and binaryOpCodes assign each unary/binary operator a small
+// byte code to carry as the OpUnary/OpBinary operand, so the VM doesn't have
+// to thread operator strings through the constant pool. and/or/|> aren't
+// included: they're compiled to jumps/OpCall rather than to these opcodes,
+// since and/or must short-circuit their right operand.
+var unaryOpCodes = map[string]byte{
+	"!": 0,
+	"-": 1,
+}
+
+var unaryOpNames = []string{"!", "-"}
+
+var binaryOpCodes = map[string]byte{
+	"=":  0,
+	"!=": 1,
+	"<":  2,
+	"<=": 3,
+	">":  4,
+	">=": 5,
+	"+":  6,
+	"-":  7,
+	"*":  8,
+	"/":  9,
+	"%":  10,
+}
+
+var binaryOpNames = []string{"=", "!=", "<", "<=", ">", ">=", "+", "-", "*", "/", "%"}
+
+// Instructions is a flat, already-encoded bytecode stream.
+type Instructions []byte
+
+// Bytecode is the output of compiling a program: the instruction stream, the
+// constant pool it indexes into, and enough source position information to
+// produce useful runtime errors.
+type Bytecode struct {
+	Instructions Instructions
+	Constants    []Value
+	SourceMap    map[int]pos
+}
+
+type opWidth struct {
+	name   string
+	widths []int // width in bytes of each operand, in order
+}
+
+var opWidths = map[Op]opWidth{
+	OpConstant:    {"OpConstant", []int{2}},
+	OpNull:        {"OpNull", nil},
+	OpPop:         {"OpPop", nil},
+	OpDup:         {"OpDup", nil},
+	OpSwap:        {"OpSwap", nil},
+	OpGetLocal:    {"OpGetLocal", []int{1}},
+	OpSetLocal:    {"OpSetLocal", []int{1}},
+	OpGetGlobal:   {"OpGetGlobal", []int{2}},
+	OpSetGlobal:   {"OpSetGlobal", []int{2}},
+	OpGetFree:     {"OpGetFree", []int{1}},
+	OpMakeList:    {"OpMakeList", []int{2}},
+	OpMakeObject:  {"OpMakeObject", []int{2}},
+	OpGetProp:     {"OpGetProp", nil},
+	OpSetProp:     {"OpSetProp", nil},
+	OpAssertType:  {"OpAssertType", []int{1}},
+	OpListTail:    {"OpListTail", []int{2}},
+	OpAssert:      {"OpAssert", []int{2}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturn:      {"OpReturn", nil},
+	OpJump:        {"OpJump", []int{2}},
+	OpJumpIfFalse: {"OpJumpIfFalse", []int{2}},
+	OpUnary:       {"OpUnary", []int{1}},
+	OpBinary:      {"OpBinary", []int{1}},
+	OpImport:      {"OpImport", []int{2}},
+}
+
+func (op Op) String() string {
+	if w, ok := opWidths[op]; ok {
+		return w.name
+	}
+	return fmt.Sprintf("Op(%d)", byte(op))
+}
+
+// make encodes a single instruction (opcode + operands) to bytes.
+func make_(op Op, operands ...int) []byte {
+	w, ok := opWidths[op]
+	if !ok {
+		panic(fmt.Sprintf("unknown opcode %d", op))
+	}
+
+	instrLen := 1
+	for _, width := range w.widths {
+		instrLen += width
+	}
+
+	instr := make([]byte, instrLen)
+	instr[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := w.widths[i]
+		switch width {
+		case 1:
+			instr[offset] = byte(operand)
+		case 2:
+			instr[offset] = byte(operand >> 8)
+			instr[offset+1] = byte(operand)
+		}
+		offset += width
+	}
+
+	return instr
+}
+
+func readUint16(ins Instructions, offset int) int {
+	return int(ins[offset])<<8 | int(ins[offset+1])
+}
+
+func readUint8(ins Instructions, offset int) int {
+	return int(ins[offset])
+}
+
+// SymbolScope identifies where in the scope chain a resolved symbol lives.
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+// Symbol is the compile-time resolution of an identifier to a numeric slot,
+// replacing the per-eval map lookups that scope.get/scope.put perform at
+// runtime.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable resolves identifiers to Symbols at compile time, mirroring the
+// parent-chain shape of scope but storing indices instead of values.
+//
+// A table is either a function boundary (the implicit top-level program, or
+// an fnNode body - pushed by enterScope) or a block nested inside one (any
+// blockNode, including an ifExprNode branch's body - pushed around its
+// compile() call with newBlockSymbolTable). Every table has its own store,
+// so a block can shadow an outer name the same way blockScope does in
+// eval.go. But Local/Global tagging and local slot numbering are properties
+// of the function a binding actually runs in, not of parser nesting depth,
+// so every table nested in the same function shares that function's table
+// through the fn field instead of tracking numDefs itself.
+type SymbolTable struct {
+	parent *SymbolTable
+	fn     *SymbolTable // nearest enclosing function-boundary table, itself if this is one
+
+	free []Symbol
+
+	store   map[string]Symbol
+	numDefs int
+}
+
+func newSymbolTable(parent *SymbolTable) *SymbolTable {
+	t := &SymbolTable{
+		parent: parent,
+		store:  map[string]Symbol{},
+	}
+	t.fn = t
+	return t
+}
+
+// newBlockSymbolTable creates a table for a block nested inside the function
+// parent itself belongs to: it gets its own store, so names defined in it
+// shadow (and stop shadowing once it's left) rather than overwriting the
+// enclosing binding, but it shares parent's function boundary for Local/
+// Global tagging and local slot numbering.
+func newBlockSymbolTable(parent *SymbolTable) *SymbolTable {
+	return &SymbolTable{
+		parent: parent,
+		fn:     parent.fn,
+		store:  map[string]Symbol{},
+	}
+}
+
+func (t *SymbolTable) define(name string) Symbol {
+	fn := t.fn
+	sym := Symbol{Name: name, Index: fn.numDefs}
+	if fn.parent == nil {
+		sym.Scope = GlobalScope
+	} else {
+		sym.Scope = LocalScope
+	}
+	fn.numDefs++
+	t.store[name] = sym
+	return sym
+}
+
+// defineFree records that a local symbol from an enclosing scope is
+// captured by the current (function) scope, returning the FreeScope symbol
+// that refers to it from inside the closure.
+func (t *SymbolTable) defineFree(original Symbol) Symbol {
+	t.free = append(t.free, original)
+
+	sym := Symbol{Name: original.Name, Index: len(t.free) - 1, Scope: FreeScope}
+	t.store[original.Name] = sym
+	return sym
+}
+
+func (t *SymbolTable) resolve(name string) (Symbol, bool) {
+	sym, ok := t.store[name]
+	if ok {
+		return sym, true
+	}
+	if t.parent == nil {
+		return Symbol{}, false
+	}
+
+	sym, ok = t.parent.resolve(name)
+	if !ok {
+		return sym, false
+	}
+
+	if sym.Scope == GlobalScope {
+		return sym, true
+	}
+
+	if t.fn == t.parent.fn {
+		// t is a block nested in the same function its parent resolved
+		// through, not a real closure boundary: the symbol already lives in
+		// this function's frame, addressable at the same index, so it's
+		// returned as-is rather than captured.
+		return sym, true
+	}
+
+	// a local (or already-free) symbol from an enclosing function scope must
+	// be captured as a free variable in every scope between there and here
+	return t.defineFree(sym), true
+}
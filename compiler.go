@@ -0,0 +1,487 @@
+package main
+
+import "fmt"
+
+// compileScope tracks the instructions being assembled for one function body
+// (or the top-level program, which is treated as an implicit function with no
+// parameters). Nested fnNodes push a new compileScope and pop it back off
+// once the body is compiled, the same way blockNode pushes and pops a scope
+// at eval time.
+type compileScope struct {
+	instructions Instructions
+}
+
+// Compiler walks the astNode tree produced by the parser and emits a flat
+// bytecode stream plus the constant pool and symbol table it depends on.
+// This replaces the identifier -> map[string]Value lookups that scope.get
+// did per-eval with identifier -> numeric slot resolution done once, here, at
+// compile time.
+type Compiler struct {
+	constants []Value
+
+	symbolTable *SymbolTable
+	scopes      []compileScope
+	scopeIndex  int
+
+	sourceMap map[int]pos
+}
+
+func newCompiler() *Compiler {
+	return &Compiler{
+		symbolTable: newSymbolTable(nil),
+		scopes:      []compileScope{{}},
+		sourceMap:   map[int]pos{},
+	}
+}
+
+func (c *Compiler) currentInstructions() Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// emit appends an instruction to the current scope's instruction stream and
+// records its position in the source map, returning the instruction pointer
+// it was written at.
+func (c *Compiler) emit(at pos, op Op, operands ...int) int {
+	ins := make_(op, operands...)
+	ip := len(c.currentInstructions())
+
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.sourceMap[ip] = at
+
+	return ip
+}
+
+func (c *Compiler) changeOperand(ip int, operand int) {
+	op := Op(c.currentInstructions()[ip])
+	newIns := make_(op, operand)
+
+	ins := c.currentInstructions()
+	for i := 0; i < len(newIns); i++ {
+		ins[ip+i] = newIns[i]
+	}
+}
+
+func (c *Compiler) addConstant(v Value) int {
+	c.constants = append(c.constants, v)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, compileScope{})
+	c.scopeIndex++
+	c.symbolTable = newSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() Instructions {
+	ins := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.parent
+
+	return ins
+}
+
+func (c *Compiler) loadSymbol(at pos, sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(at, OpGetGlobal, sym.Index)
+	case LocalScope:
+		c.emit(at, OpGetLocal, sym.Index)
+	case FreeScope:
+		c.emit(at, OpGetFree, sym.Index)
+	}
+}
+
+// compile walks node and its children, emitting bytecode into the current
+// scope. It handles the same node kinds as evalExpr, though not in the same
+// case order.
+func (c *Compiler) compile(node astNode) error {
+	at := nodePos(node)
+
+	switch n := node.(type) {
+	case emptyNode, nullNode:
+		c.emit(at, OpNull)
+	case stringNode:
+		c.emit(at, OpConstant, c.addConstant(StringValue([]byte(n.payload))))
+	case numberNode:
+		if n.isInteger {
+			c.emit(at, OpConstant, c.addConstant(IntValue(n.intPayload)))
+		} else {
+			c.emit(at, OpConstant, c.addConstant(FloatValue(n.floatPayload)))
+		}
+	case booleanNode:
+		c.emit(at, OpConstant, c.addConstant(BoolValue(n.payload)))
+	case atomNode:
+		c.emit(at, OpConstant, c.addConstant(AtomValue(n.payload)))
+	case listNode:
+		for _, el := range n.elems {
+			if err := c.compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(at, OpMakeList, len(n.elems))
+	case objectNode:
+		for _, entry := range n.entries {
+			if identKey, ok := entry.key.(identifierNode); ok {
+				c.emit(at, OpConstant, c.addConstant(StringValue([]byte(identKey.payload))))
+			} else if err := c.compile(entry.key); err != nil {
+				return err
+			}
+			if err := c.compile(entry.val); err != nil {
+				return err
+			}
+		}
+		c.emit(at, OpMakeObject, len(n.entries))
+	case identifierNode:
+		sym, ok := c.symbolTable.resolve(n.payload)
+		if !ok {
+			return runtimeError{reason: fmt.Sprintf("%s is undefined", n.payload)}
+		}
+		c.loadSymbol(at, sym)
+	case importNode:
+		c.emit(at, OpImport, c.addConstant(StringValue([]byte(n.path))))
+	case propertyAccessNode:
+		if err := c.compile(n.left); err != nil {
+			return err
+		}
+		if err := c.compile(n.right); err != nil {
+			return err
+		}
+		c.emit(at, OpGetProp)
+	case fnNode:
+		c.enterScope()
+
+		for _, argName := range n.args {
+			c.symbolTable.define(argName)
+		}
+		// a named function literal can call itself by name from inside its
+		// own body (eval.go's fnNode case binds fn.defn.name the same way);
+		// give it a local slot one past its parameters so OpCall can seed it
+		// with the closure value being constructed.
+		if n.name != "" {
+			c.symbolTable.define(n.name)
+		}
+		if err := c.compile(n.body); err != nil {
+			return err
+		}
+		c.emit(at, OpReturn)
+
+		freeSymbols := c.symbolTable.free
+		numLocals := c.symbolTable.numDefs
+		body := c.leaveScope()
+
+		for _, freeSym := range freeSymbols {
+			c.loadSymbol(at, freeSym)
+		}
+
+		fnConst := c.addConstant(CompiledFunction{
+			defn:         &n,
+			Instructions: body,
+			NumLocals:    numLocals,
+			NumParams:    len(n.args),
+		})
+		c.emit(at, OpClosure, fnConst, len(freeSymbols))
+	case fnCallNode:
+		if err := c.compile(n.fn); err != nil {
+			return err
+		}
+		for _, argNode := range n.args {
+			if err := c.compile(argNode); err != nil {
+				return err
+			}
+		}
+		c.emit(at, OpCall, len(n.args))
+	case ifExprNode:
+		if err := c.compile(n.cond); err != nil {
+			return err
+		}
+
+		// invariant: at the top of each iteration, the stack holds exactly
+		// one value, cond. OpDup keeps that copy around for the next branch
+		// while this branch's comparison consumes its own copy.
+		var jumpToEnds []int
+		for _, branch := range n.branches {
+			c.emit(at, OpDup)
+			if err := c.compile(branch.target); err != nil {
+				return err
+			}
+			c.emit(at, OpBinary, int(binaryOpCodes["="]))
+			jumpIfNotEqual := c.emit(at, OpJumpIfFalse, 9999)
+			c.emit(at, OpPop) // matched: discard the remaining cond copy
+			if err := c.compile(branch.body); err != nil {
+				return err
+			}
+			jumpToEnds = append(jumpToEnds, c.emit(at, OpJump, 9999))
+			c.changeOperand(jumpIfNotEqual, len(c.currentInstructions()))
+		}
+		c.emit(at, OpPop) // no branch matched: discard cond
+		c.emit(at, OpNull)
+		for _, jp := range jumpToEnds {
+			c.changeOperand(jp, len(c.currentInstructions()))
+		}
+	case blockNode:
+		// a block gets its own SymbolTable, the same way eval.go's blockNode
+		// case gets its own blockScope: a `x := ...` inside shadows an outer
+		// x for the rest of the block and stops shadowing once it's left,
+		// rather than permanently overwriting the outer binding's slot.
+		// newBlockSymbolTable shares this function's Local/Global tagging
+		// and slot numbering, so this is purely about name resolution, not
+		// a new call frame.
+		outer := c.symbolTable
+		c.symbolTable = newBlockSymbolTable(outer)
+		defer func() { c.symbolTable = outer }()
+
+		if len(n.exprs) == 0 {
+			c.emit(at, OpNull)
+			break
+		}
+		for i, expr := range n.exprs {
+			if i > 0 {
+				c.emit(at, OpPop)
+			}
+			if err := c.compile(expr); err != nil {
+				return err
+			}
+		}
+	case assignmentNode:
+		switch left := n.left.(type) {
+		case identifierNode:
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			if err := c.emitBinding(at, left.payload, n.isLocal); err != nil {
+				return err
+			}
+		case listNode:
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			if err := c.compileListDestructure(left, n.isLocal, at); err != nil {
+				return err
+			}
+		case objectNode:
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			if err := c.compileObjectDestructure(left, n.isLocal, at); err != nil {
+				return err
+			}
+		case propertyAccessNode:
+			if err := c.compile(left.left); err != nil {
+				return err
+			}
+			if err := c.compile(left.right); err != nil {
+				return err
+			}
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			c.emit(at, OpSetProp)
+		default:
+			return vmError{reason: "Illegal left-hand side of assignment"}
+		}
+	case unaryNode:
+		if err := c.compile(n.operand); err != nil {
+			return err
+		}
+		code, ok := unaryOpCodes[n.op]
+		if !ok {
+			return runtimeError{reason: fmt.Sprintf("unknown unary operator %s", n.op)}
+		}
+		c.emit(at, OpUnary, int(code))
+	case binaryNode:
+		switch n.op {
+		case "and":
+			if err := c.compile(n.left); err != nil {
+				return err
+			}
+			jumpLeftFalse := c.emit(at, OpJumpIfFalse, 9999)
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			jumpRightFalse := c.emit(at, OpJumpIfFalse, 9999)
+			c.emit(at, OpConstant, c.addConstant(mgnTrue))
+			jumpEnd := c.emit(at, OpJump, 9999)
+			c.changeOperand(jumpLeftFalse, len(c.currentInstructions()))
+			c.changeOperand(jumpRightFalse, len(c.currentInstructions()))
+			c.emit(at, OpConstant, c.addConstant(mgnFalse))
+			c.changeOperand(jumpEnd, len(c.currentInstructions()))
+		case "or":
+			if err := c.compile(n.left); err != nil {
+				return err
+			}
+			jumpLeftFalse := c.emit(at, OpJumpIfFalse, 9999)
+			c.emit(at, OpConstant, c.addConstant(mgnTrue))
+			jumpTrueEnd := c.emit(at, OpJump, 9999)
+			c.changeOperand(jumpLeftFalse, len(c.currentInstructions()))
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			jumpRightFalse := c.emit(at, OpJumpIfFalse, 9999)
+			c.emit(at, OpConstant, c.addConstant(mgnTrue))
+			jumpEnd := c.emit(at, OpJump, 9999)
+			c.changeOperand(jumpRightFalse, len(c.currentInstructions()))
+			c.emit(at, OpConstant, c.addConstant(mgnFalse))
+			c.changeOperand(jumpEnd, len(c.currentInstructions()))
+			c.changeOperand(jumpTrueEnd, len(c.currentInstructions()))
+		case "|>":
+			// the piped value must be evaluated before the callee, matching
+			// eval.go, but the callee still needs to end up under its
+			// argument on the stack for OpCall: compile left then right and
+			// swap them into call order rather than compiling right first.
+			if err := c.compile(n.left); err != nil {
+				return err
+			}
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			c.emit(at, OpSwap)
+			c.emit(at, OpCall, 1)
+		default:
+			if err := c.compile(n.left); err != nil {
+				return err
+			}
+			if err := c.compile(n.right); err != nil {
+				return err
+			}
+			code, ok := binaryOpCodes[n.op]
+			if !ok {
+				return runtimeError{reason: fmt.Sprintf("unknown binary operator %s", n.op)}
+			}
+			c.emit(at, OpBinary, int(code))
+		}
+	default:
+		c.emit(at, OpNull)
+	}
+
+	return nil
+}
+
+// emitBinding resolves name to a symbol the same way a plain identifier
+// assignment does (defining a new one when isLocal, otherwise requiring one
+// to already exist) and emits the matching OpSet{Local,Global}. It backs
+// identifier assignment as well as every leaf binding in a destructuring
+// pattern.
+func (c *Compiler) emitBinding(at pos, name string, isLocal bool) error {
+	var sym Symbol
+	if isLocal {
+		sym = c.symbolTable.define(name)
+	} else {
+		var found bool
+		sym, found = c.symbolTable.resolve(name)
+		if !found {
+			return runtimeError{reason: fmt.Sprintf("%s is undefined", name)}
+		}
+	}
+
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(at, OpSetGlobal, sym.Index)
+	case LocalScope:
+		c.emit(at, OpSetLocal, sym.Index)
+	default:
+		return vmError{reason: fmt.Sprintf("cannot assign to free variable %s", name)}
+	}
+	return nil
+}
+
+// compileListDestructure lowers `[a, b, ...rest] := expr`. The value of expr
+// is already on top of the stack by the time this runs (left there by the
+// assignmentNode case) and is left there again once this returns: OpAssertType
+// checks it's a list without consuming it, then each pattern element peeks a
+// fresh OpDup'd copy, extracts its slot, binds it, and pops that copy,
+// mirroring destructureList's behavior at eval time.
+func (c *Compiler) compileListDestructure(pattern listNode, isLocal bool, at pos) error {
+	c.emit(at, OpAssertType, int(listTypeTag))
+
+	for i, el := range pattern.elems {
+		if spread, ok := el.(spreadNode); ok {
+			ident, ok := spread.target.(identifierNode)
+			if !ok {
+				return runtimeError{reason: "Expected an identifier in rest binding"}
+			}
+
+			c.emit(at, OpDup)
+			c.emit(at, OpListTail, i)
+			if err := c.emitBinding(at, ident.payload, isLocal); err != nil {
+				return err
+			}
+			c.emit(at, OpPop)
+			return nil
+		}
+
+		ident, ok := el.(identifierNode)
+		if !ok {
+			return runtimeError{reason: "Expected an identifier in list destructuring pattern"}
+		}
+
+		c.emit(at, OpDup)
+		c.emit(at, OpConstant, c.addConstant(IntValue(i)))
+		c.emit(at, OpGetProp)
+		if err := c.emitBinding(at, ident.payload, isLocal); err != nil {
+			return err
+		}
+		c.emit(at, OpPop)
+	}
+	return nil
+}
+
+// compileObjectDestructure lowers `{a, b: x, c: 0} := expr` the same way
+// compileListDestructure lowers list patterns: shorthand `a` and renamed
+// `b: x` entries bind a fresh field lookup to a symbol, while an entry whose
+// value side isn't an identifier (e.g. `c: 0`) is a literal pattern compiled
+// and compared with OpBinary, asserted to hold with OpAssert.
+func (c *Compiler) compileObjectDestructure(pattern objectNode, isLocal bool, at pos) error {
+	c.emit(at, OpAssertType, int(objectTypeTag))
+
+	for _, entry := range pattern.entries {
+		keyIdent, ok := entry.key.(identifierNode)
+		if !ok {
+			return runtimeError{reason: "Expected an identifier as an object destructuring key"}
+		}
+
+		switch target := entry.val.(type) {
+		case identifierNode:
+			c.emit(at, OpDup)
+			c.emit(at, OpConstant, c.addConstant(StringValue([]byte(keyIdent.payload))))
+			c.emit(at, OpGetProp)
+			if err := c.emitBinding(at, target.payload, isLocal); err != nil {
+				return err
+			}
+			c.emit(at, OpPop)
+		default:
+			c.emit(at, OpDup)
+			c.emit(at, OpConstant, c.addConstant(StringValue([]byte(keyIdent.payload))))
+			c.emit(at, OpGetProp)
+			if err := c.compile(entry.val); err != nil {
+				return err
+			}
+			c.emit(at, OpBinary, int(binaryOpCodes["="]))
+			msg := fmt.Sprintf("Expected %s to match the object destructuring pattern", keyIdent.payload)
+			c.emit(at, OpAssert, c.addConstant(StringValue([]byte(msg))))
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) bytecode() Bytecode {
+	return Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.sourceMap,
+	}
+}
+
+// nodePos extracts the source position embedded in a concrete astNode value,
+// falling back to the zero pos for node kinds that don't carry one (e.g. the
+// interned emptyNode/nullNode).
+func nodePos(node astNode) pos {
+	type positioned interface {
+		Pos() pos
+	}
+	if p, ok := node.(positioned); ok {
+		return p.Pos()
+	}
+	return pos{}
+}
@@ -0,0 +1,316 @@
+package main
+
+import "testing"
+
+// runAST evaluates a sequence of expressions as a single block through the
+// tree-walking evaluator. TestDestructureAndPropertyAssignmentThroughVM below
+// drives the same forms through the compiler/VM pipeline.
+func runAST(t *testing.T, exprs ...astNode) (Value, error) {
+	t.Helper()
+	c := NewContext("<test>", ".")
+	return c.evalExpr(blockNode{exprs: exprs}, c.scope)
+}
+
+func ident(name string) identifierNode { return identifierNode{payload: name} }
+func num(n int64) numberNode           { return numberNode{isInteger: true, intPayload: n} }
+func str(s string) stringNode          { return stringNode{payload: s} }
+
+func assignLocal(left, right astNode) assignmentNode {
+	return assignmentNode{left: left, right: right, isLocal: true}
+}
+
+func TestDestructureList(t *testing.T) {
+	t.Run("positional binding", func(t *testing.T) {
+		// [a, b] := [1, 2]
+		got, err := runAST(t,
+			assignLocal(listNode{elems: []astNode{ident("a"), ident("b")}}, listNode{elems: []astNode{num(1), num(2)}}),
+			listNode{elems: []astNode{ident("a"), ident("b")}},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := ListValue{IntValue(1), IntValue(2)}
+		if !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("missing positions bind to null", func(t *testing.T) {
+		// [a, b] := [1]
+		got, err := runAST(t,
+			assignLocal(listNode{elems: []astNode{ident("a"), ident("b")}}, listNode{elems: []astNode{num(1)}}),
+			ident("b"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != null {
+			t.Fatalf("got %s, want null", got.String())
+		}
+	})
+
+	t.Run("rest pattern collects remaining elements", func(t *testing.T) {
+		// [a, ...rest] := [1, 2, 3]
+		got, err := runAST(t,
+			assignLocal(
+				listNode{elems: []astNode{ident("a"), spreadNode{target: ident("rest")}}},
+				listNode{elems: []astNode{num(1), num(2), num(3)}},
+			),
+			ident("rest"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := ListValue{IntValue(2), IntValue(3)}
+		if !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("rest pattern on an exhausted list is empty", func(t *testing.T) {
+		// [a, ...rest] := [1]
+		got, err := runAST(t,
+			assignLocal(
+				listNode{elems: []astNode{ident("a"), spreadNode{target: ident("rest")}}},
+				listNode{elems: []astNode{num(1)}},
+			),
+			ident("rest"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := ListValue{}
+		if !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("non-list right-hand side errors", func(t *testing.T) {
+		_, err := runAST(t,
+			assignLocal(listNode{elems: []astNode{ident("a")}}, num(1)),
+		)
+		if err == nil {
+			t.Fatal("expected error destructuring a non-list value")
+		}
+	})
+}
+
+func TestDestructureObject(t *testing.T) {
+	objLiteral := func(entries ...objectEntry) objectNode {
+		return objectNode{entries: entries}
+	}
+
+	t.Run("shorthand binds by key name", func(t *testing.T) {
+		// {a} := {a: 1}
+		got, err := runAST(t,
+			assignLocal(objLiteral(objectEntry{key: ident("a"), val: ident("a")}), objLiteral(objectEntry{key: ident("a"), val: num(1)})),
+			ident("a"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !got.Eq(IntValue(1)) {
+			t.Fatalf("got %s, want 1", got.String())
+		}
+	})
+
+	t.Run("rename binds field to a different name", func(t *testing.T) {
+		// {b: x} := {b: 2}
+		got, err := runAST(t,
+			assignLocal(objLiteral(objectEntry{key: ident("b"), val: ident("x")}), objLiteral(objectEntry{key: ident("b"), val: num(2)})),
+			ident("x"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !got.Eq(IntValue(2)) {
+			t.Fatalf("got %s, want 2", got.String())
+		}
+	})
+
+	t.Run("literal pattern matches", func(t *testing.T) {
+		// {c: 0} := {c: 0}
+		_, err := runAST(t,
+			assignLocal(objLiteral(objectEntry{key: ident("c"), val: num(0)}), objLiteral(objectEntry{key: ident("c"), val: num(0)})),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("literal pattern mismatch errors", func(t *testing.T) {
+		// {c: 0} := {c: 1}
+		_, err := runAST(t,
+			assignLocal(objLiteral(objectEntry{key: ident("c"), val: num(0)}), objLiteral(objectEntry{key: ident("c"), val: num(1)})),
+		)
+		if err == nil {
+			t.Fatal("expected error from a mismatched literal pattern")
+		}
+	})
+
+	t.Run("missing key binds to null", func(t *testing.T) {
+		// {missing} := {a: 1}
+		got, err := runAST(t,
+			assignLocal(objLiteral(objectEntry{key: ident("missing"), val: ident("missing")}), objLiteral(objectEntry{key: ident("a"), val: num(1)})),
+			ident("missing"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != null {
+			t.Fatalf("got %s, want null", got.String())
+		}
+	})
+}
+
+func TestPropertyAssignment(t *testing.T) {
+	t.Run("list index in range", func(t *testing.T) {
+		got, err := runAST(t,
+			assignLocal(ident("lst"), listNode{elems: []astNode{num(1), num(2), num(3)}}),
+			assignmentNode{left: propertyAccessNode{left: ident("lst"), right: num(1)}, right: num(99)},
+			ident("lst"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := ListValue{IntValue(1), IntValue(99), IntValue(3)}
+		if !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("list index out of range errors", func(t *testing.T) {
+		_, err := runAST(t,
+			assignLocal(ident("lst"), listNode{elems: []astNode{num(1)}}),
+			assignmentNode{left: propertyAccessNode{left: ident("lst"), right: num(5)}, right: num(99)},
+		)
+		if err == nil {
+			t.Fatal("expected error assigning out of range")
+		}
+	})
+
+	t.Run("object key", func(t *testing.T) {
+		got, err := runAST(t,
+			assignLocal(ident("obj"), objectNode{entries: []objectEntry{{key: ident("a"), val: num(1)}}}),
+			assignmentNode{left: propertyAccessNode{left: ident("obj"), right: str("a")}, right: num(2)},
+			ident("obj"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := ObjectValue{"a": IntValue(2)}
+		if !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("string index out of range errors", func(t *testing.T) {
+		_, err := runAST(t,
+			assignLocal(ident("s"), str("ab")),
+			assignmentNode{left: propertyAccessNode{left: ident("s"), right: num(5)}, right: str("x")},
+		)
+		if err == nil {
+			t.Fatal("expected error assigning out of range")
+		}
+	})
+}
+
+// TestDestructureAndPropertyAssignmentThroughVM drives the same forms
+// through the compiler/VM pipeline via evalBoth, the path Context.Eval
+// actually takes: it previously rejected every one of these with
+// "compiling non-identifier assignment targets is not yet supported".
+func TestDestructureAndPropertyAssignmentThroughVM(t *testing.T) {
+	t.Run("list destructuring with rest", func(t *testing.T) {
+		// [a, ...rest] := [1, 2, 3]; rest
+		node := blockNode{exprs: []astNode{
+			assignLocal(
+				listNode{elems: []astNode{ident("a"), spreadNode{target: ident("rest")}}},
+				listNode{elems: []astNode{num(1), num(2), num(3)}},
+			),
+			ident("rest"),
+		}}
+		_, vm, _, vmErr := evalBoth(t, node)
+		if vmErr != nil {
+			t.Fatalf("VM eval: unexpected error: %s", vmErr)
+		}
+		want := ListValue{IntValue(2), IntValue(3)}
+		if !vm.Eq(want) {
+			t.Fatalf("VM eval = %s, want %s", vm.String(), want.String())
+		}
+	})
+
+	t.Run("list destructuring of a non-list errors", func(t *testing.T) {
+		node := blockNode{exprs: []astNode{
+			assignLocal(listNode{elems: []astNode{ident("a")}}, num(1)),
+		}}
+		_, _, _, vmErr := evalBoth(t, node)
+		if vmErr == nil {
+			t.Fatal("VM eval: expected error destructuring a non-list value")
+		}
+	})
+
+	t.Run("object destructuring with rename and literal pattern", func(t *testing.T) {
+		// {b: x, c: 0} := {b: 2, c: 0}; x
+		objLiteral := objectNode{entries: []objectEntry{
+			{key: ident("b"), val: num(2)},
+			{key: ident("c"), val: num(0)},
+		}}
+		node := blockNode{exprs: []astNode{
+			assignLocal(objectNode{entries: []objectEntry{
+				{key: ident("b"), val: ident("x")},
+				{key: ident("c"), val: num(0)},
+			}}, objLiteral),
+			ident("x"),
+		}}
+		_, vm, _, vmErr := evalBoth(t, node)
+		if vmErr != nil {
+			t.Fatalf("VM eval: unexpected error: %s", vmErr)
+		}
+		if !vm.Eq(IntValue(2)) {
+			t.Fatalf("VM eval = %s, want 2", vm.String())
+		}
+	})
+
+	t.Run("object destructuring literal pattern mismatch errors", func(t *testing.T) {
+		node := blockNode{exprs: []astNode{
+			assignLocal(objectNode{entries: []objectEntry{{key: ident("c"), val: num(0)}}}, objectNode{entries: []objectEntry{{key: ident("c"), val: num(1)}}}),
+		}}
+		_, _, _, vmErr := evalBoth(t, node)
+		if vmErr == nil {
+			t.Fatal("VM eval: expected error from a mismatched literal pattern")
+		}
+	})
+
+	t.Run("property assignment into a list", func(t *testing.T) {
+		// lst := [1, 2, 3]; lst.1 := 99; lst
+		node := blockNode{exprs: []astNode{
+			assignLocal(ident("lst"), listNode{elems: []astNode{num(1), num(2), num(3)}}),
+			assignmentNode{left: propertyAccessNode{left: ident("lst"), right: num(1)}, right: num(99)},
+			ident("lst"),
+		}}
+		_, vm, _, vmErr := evalBoth(t, node)
+		if vmErr != nil {
+			t.Fatalf("VM eval: unexpected error: %s", vmErr)
+		}
+		want := ListValue{IntValue(1), IntValue(99), IntValue(3)}
+		if !vm.Eq(want) {
+			t.Fatalf("VM eval = %s, want %s", vm.String(), want.String())
+		}
+	})
+
+	t.Run("property assignment into an object", func(t *testing.T) {
+		node := blockNode{exprs: []astNode{
+			assignLocal(ident("obj"), objectNode{entries: []objectEntry{{key: ident("a"), val: num(1)}}}),
+			assignmentNode{left: propertyAccessNode{left: ident("obj"), right: str("a")}, right: num(2)},
+			ident("obj"),
+		}}
+		_, vm, _, vmErr := evalBoth(t, node)
+		if vmErr != nil {
+			t.Fatalf("VM eval: unexpected error: %s", vmErr)
+		}
+		want := ObjectValue{"a": IntValue(2)}
+		if !vm.Eq(want) {
+			t.Fatalf("VM eval = %s, want %s", vm.String(), want.String())
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -287,12 +288,41 @@ type Context struct {
 	SourcePath string
 	// top level ("global") scope of this context
 	scope
-}
+
+	// AllowFileImport gates whether import expressions may resolve to files
+	// on disk, relative to Cwd. It defaults to false so embedders can safely
+	// run untrusted scripts that can only reach in-process modules
+	// registered with RegisterModule.
+	AllowFileImport bool
+	// ImportFileExt is the list of extensions tried, in order, when an
+	// import name has no extension of its own, or has one but no file exists
+	// at that exact path.
+	ImportFileExt []string
+	// Modules, if set, overrides the default Cwd-relative file resolution
+	// and RegisterModule registry entirely.
+	Modules ModuleGetter
+
+	// MaxStackDepth bounds how many nested function calls evalExpr will make
+	// before returning a runtimeError, since the evaluator recurses through
+	// Go's own call stack and would otherwise panic with a stack overflow.
+	MaxStackDepth int
+
+	modules    *moduleRegistry
+	callStack  *stackEntry
+	stackDepth int
+}
+
+// defaultMaxStackDepth is chosen comfortably below where a recursive
+// evalExpr call chain would overflow Go's own stack on a typical goroutine.
+const defaultMaxStackDepth = 1 << 14
 
 func NewContext(path, cwd string) Context {
 	return Context{
-		Cwd:        cwd,
-		SourcePath: path,
+		Cwd:           cwd,
+		SourcePath:    path,
+		ImportFileExt: []string{".oak"},
+		MaxStackDepth: defaultMaxStackDepth,
+		modules:       newModuleRegistry(),
 		scope: scope{
 			parent: nil,
 			vars:   map[string]Value{},
@@ -300,9 +330,145 @@ func NewContext(path, cwd string) Context {
 	}
 }
 
-func (c *Context) generateStackTrace() stackEntry {
-	// TODO: actually write
-	return stackEntry{}
+// err builds a runtimeError at the given node's source position, chaining it
+// onto whatever call stack is active when the error is raised.
+func (c *Context) err(at astNode, format string, args ...interface{}) runtimeError {
+	return runtimeError{
+		reason:     fmt.Sprintf(format, args...),
+		sourcePath: c.SourcePath,
+		stackTrace: stackEntry{pos: nodePos(at), parentStack: c.callStack},
+	}
+}
+
+// wrapErr attaches the current call stack and node position to an error
+// that was raised somewhere without Context access (e.g. scope.get),
+// leaving any other error type untouched.
+func (c *Context) wrapErr(at astNode, err error) error {
+	re, ok := err.(runtimeError)
+	if !ok {
+		return err
+	}
+	re.sourcePath = c.SourcePath
+	re.stackTrace = stackEntry{pos: nodePos(at), parentStack: c.callStack}
+	return re
+}
+
+// bindName assigns v to name in sc, honoring isLocal the same way
+// identifier assignment does: isLocal declares a new binding in the
+// innermost scope, otherwise the nearest existing binding is updated.
+func bindName(sc scope, isLocal bool, name string, v Value) error {
+	if isLocal {
+		sc.put(name, v)
+		return nil
+	}
+	return sc.update(name, v)
+}
+
+// destructureList implements `[a, b, ...tail] := expr`: elements bind
+// positionally, missing positions bind to null, and a trailing rest pattern
+// collects whatever positions are left into a new ListValue.
+func (c *Context) destructureList(pattern listNode, val ListValue, sc scope, isLocal bool) error {
+	for i, el := range pattern.elems {
+		if spread, ok := el.(spreadNode); ok {
+			ident, ok := spread.target.(identifierNode)
+			if !ok {
+				return c.err(el, "Expected an identifier in rest binding")
+			}
+
+			rest := ListValue{}
+			if i < len(val) {
+				rest = append(rest, val[i:]...)
+			}
+			if err := bindName(sc, isLocal, ident.payload, rest); err != nil {
+				return c.wrapErr(el, err)
+			}
+			return nil
+		}
+
+		ident, ok := el.(identifierNode)
+		if !ok {
+			return c.err(el, "Expected an identifier in list destructuring pattern")
+		}
+
+		var elVal Value = null
+		if i < len(val) {
+			elVal = val[i]
+		}
+		if err := bindName(sc, isLocal, ident.payload, elVal); err != nil {
+			return c.wrapErr(el, err)
+		}
+	}
+	return nil
+}
+
+// destructureObject implements `{a, b: x, c: 0} := expr`: shorthand `a`
+// binds key "a" to local a, `b: x` binds expr.b to x, and an entry whose
+// value side isn't an identifier (e.g. `c: 0`) is a literal pattern that
+// must match the field's value or the whole assignment fails.
+func (c *Context) destructureObject(pattern objectNode, val ObjectValue, sc scope, isLocal bool) error {
+	for _, entry := range pattern.entries {
+		keyIdent, ok := entry.key.(identifierNode)
+		if !ok {
+			return c.err(entry.key, "Expected an identifier as an object destructuring key")
+		}
+
+		fieldVal, present := val[keyIdent.payload]
+		if !present {
+			fieldVal = null
+		}
+
+		switch target := entry.val.(type) {
+		case identifierNode:
+			if err := bindName(sc, isLocal, target.payload, fieldVal); err != nil {
+				return c.wrapErr(entry.val, err)
+			}
+		default:
+			expected, err := c.evalExpr(entry.val, sc)
+			if err != nil {
+				return err
+			}
+			if !fieldVal.Eq(expected) {
+				return c.err(entry.val, "Expected %s to equal %s, got %s", keyIdent.payload, expected.String(), fieldVal.String())
+			}
+		}
+	}
+	return nil
+}
+
+// callValue invokes fnVal (an FnValue or BuiltinFnValue) with args, pushing
+// a stackEntry for the duration of the call the same way the fnCallNode
+// branch of evalExpr does. It's shared by fnCallNode and the |> pipeline
+// operator so there's only one place that knows how to make a call.
+func (c *Context) callValue(fnVal Value, args []Value, at astNode) (Value, error) {
+	switch fn := fnVal.(type) {
+	case FnValue:
+		if c.MaxStackDepth > 0 && c.stackDepth >= c.MaxStackDepth {
+			return nil, c.err(at, "maximum call stack size (%d) exceeded", c.MaxStackDepth)
+		}
+
+		// TODO: implement restArgs
+		args = args[:len(fn.defn.args)]
+		fnScope := scope{
+			parent: &fn.scope,
+			vars:   map[string]Value{},
+		}
+		for i, argName := range fn.defn.args {
+			fnScope.put(argName, args[i])
+		}
+
+		entry := stackEntry{fnName: fn.defn.name, pos: nodePos(at), parentStack: c.callStack}
+		c.callStack = &entry
+		c.stackDepth++
+		result, err := c.evalExpr(fn.defn.body, fnScope)
+		c.stackDepth--
+		c.callStack = entry.parentStack
+
+		return result, err
+	case BuiltinFnValue:
+		return fn.fn(args)
+	default:
+		return nil, c.err(at, "%s is not a function and cannot be called", fnVal)
+	}
 }
 
 type stackEntry struct {
@@ -321,25 +487,42 @@ func (e vmError) Error() string {
 
 type runtimeError struct {
 	reason     string
+	sourcePath string
 	stackTrace stackEntry
 }
 
+// Error renders a Go-style multi-line trace: the error message, followed by
+// one "at <fn> (<path>:<line>:<col>)" line per call frame, innermost first.
 func (e runtimeError) Error() string {
-	// TODO: display stacktrace
-	return fmt.Sprintf("Runtime error: %s", e.reason)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Runtime error: %s", e.reason)
+
+	for entry := &e.stackTrace; entry != nil; entry = entry.parentStack {
+		fnName := entry.fnName
+		if fnName == "" {
+			fnName = "<anonymous>"
+		}
+		fmt.Fprintf(&b, "\n\tat %s (%s:%d:%d)", fnName, e.sourcePath, entry.pos.line, entry.pos.col)
+	}
+
+	return b.String()
 }
 
 func (c *Context) Eval(programReader io.Reader) (Value, error) {
-	program, err := io.ReadAll(programReader)
+	nodes, err := c.parse(programReader)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenizer := newTokenizer(string(program))
-	tokens := tokenizer.tokenize()
+	return c.EvalBytecode(nodes)
+}
 
-	parser := newParser(tokens)
-	nodes, err := parser.parse()
+// EvalAST runs program through the original recursive tree-walking
+// evaluator instead of compiling it to bytecode first. It exists for
+// debugging the evaluator itself, and is otherwise slower than Eval for any
+// non-trivial program.
+func (c *Context) EvalAST(programReader io.Reader) (Value, error) {
+	nodes, err := c.parse(programReader)
 	if err != nil {
 		return nil, err
 	}
@@ -347,9 +530,33 @@ func (c *Context) Eval(programReader io.Reader) (Value, error) {
 	return c.evalProgram(nodes)
 }
 
+func (c *Context) parse(programReader io.Reader) ([]astNode, error) {
+	program, err := io.ReadAll(programReader)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizer := newTokenizer(string(program))
+	tokens := tokenizer.tokenize()
+
+	parser := newParser(tokens)
+	return parser.parse()
+}
+
 func (c *Context) evalProgram(nodes []astNode) (Value, error) {
-	programBlock := blockNode{exprs: nodes}
-	return c.evalExpr(programBlock, c.scope)
+	// Unlike blockNode, the program's top-level exprs are evaluated directly
+	// against c.scope rather than a fresh child scope, so top-level `:=`
+	// bindings land in c.scope.vars where importFile can read them back out
+	// as the file's exports.
+	var err error
+	var returnVal Value = null
+	for _, expr := range nodes {
+		returnVal, err = c.evalExpr(expr, c.scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return returnVal, nil
 }
 
 func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
@@ -399,9 +606,7 @@ func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
 				case FloatValue:
 					keyString = typedKey.String()
 				default:
-					return nil, runtimeError{
-						reason: fmt.Sprintf("Expected a string or number as object key, got %s", key.String()),
-					}
+					return nil, c.err(entry.key, "Expected a string or number as object key, got %s", key.String())
 				}
 			}
 
@@ -423,7 +628,13 @@ func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
 		}
 		return fn, nil
 	case identifierNode:
-		return sc.get(n.payload)
+		v, err := sc.get(n.payload)
+		if err != nil {
+			return nil, c.wrapErr(n, err)
+		}
+		return v, nil
+	case importNode:
+		return c.resolveImport(n.path)
 	case assignmentNode:
 		assignedValue, err := c.evalExpr(n.right, sc)
 		if err != nil {
@@ -434,21 +645,43 @@ func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
 			if n.isLocal {
 				sc.put(left.payload, assignedValue)
 			} else {
-				err := sc.update(left.payload, assignedValue)
-				if err != nil {
-					return nil, err
+				if err := sc.update(left.payload, assignedValue); err != nil {
+					return nil, c.wrapErr(left, err)
 				}
 			}
 			return assignedValue, nil
 		case listNode:
-			// TODO: implement list destructuring assignment
-			panic("list destructuring not implemented!")
+			listVal, ok := assignedValue.(ListValue)
+			if !ok {
+				return nil, c.err(n.right, "Expected a list on the right-hand side of list destructuring, got %s", assignedValue.String())
+			}
+			if err := c.destructureList(left, listVal, sc, n.isLocal); err != nil {
+				return nil, err
+			}
+			return assignedValue, nil
 		case objectNode:
-			// TODO: implement object destructuring assignment
-			panic("object destructuring not implemented!")
+			objVal, ok := assignedValue.(ObjectValue)
+			if !ok {
+				return nil, c.err(n.right, "Expected an object on the right-hand side of object destructuring, got %s", assignedValue.String())
+			}
+			if err := c.destructureObject(left, objVal, sc, n.isLocal); err != nil {
+				return nil, err
+			}
+			return assignedValue, nil
 		case propertyAccessNode:
-			// TODO: implement object property assignment
-			panic("assign to property not implemented!")
+			target, err := c.evalExpr(left.left, sc)
+			if err != nil {
+				return nil, err
+			}
+			key, err := c.evalExpr(left.right, sc)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := setProperty(target, key, assignedValue); err != nil {
+				return nil, c.wrapErr(left, err)
+			}
+			return assignedValue, nil
 		}
 		panic(fmt.Sprintf("Illegal left-hand side of assignment in %s", n))
 	case propertyAccessNode:
@@ -462,52 +695,77 @@ func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
 			return nil, err
 		}
 
-		switch target := left.(type) {
-		case StringValue:
-			byteIndex, ok := right.(IntValue)
+		val, err := getProperty(left, right)
+		if err != nil {
+			return nil, c.wrapErr(n, err)
+		}
+		return val, nil
+	case unaryNode:
+		operand, err := c.evalExpr(n.operand, sc)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := unaryOp(n.op, operand)
+		if err != nil {
+			return nil, c.err(n, "%s", err)
+		}
+		return result, nil
+	case binaryNode:
+		switch n.op {
+		case "and", "or":
+			left, err := c.evalExpr(n.left, sc)
+			if err != nil {
+				return nil, err
+			}
+			leftBool, ok := left.(BoolValue)
 			if !ok {
-				return nil, runtimeError{
-					reason: fmt.Sprintf("Cannot index into string with non-integer index %s", right),
-				}
+				return nil, c.err(n, "Left operand of %s must be a bool, got %s", n.op, left.String())
 			}
 
-			if byteIndex < 0 || int64(byteIndex) > int64(len(target)) {
-				return null, nil
+			// short-circuit: the right operand is only evaluated if it can
+			// change the result, so it must not be eval'd eagerly above.
+			if n.op == "and" && !bool(leftBool) {
+				return mgnFalse, nil
+			}
+			if n.op == "or" && bool(leftBool) {
+				return mgnTrue, nil
 			}
 
-			return StringValue([]byte{target[byteIndex]}), nil
-		case ListValue:
-			listIndex, ok := right.(IntValue)
+			right, err := c.evalExpr(n.right, sc)
+			if err != nil {
+				return nil, err
+			}
+			rightBool, ok := right.(BoolValue)
 			if !ok {
-				return nil, runtimeError{
-					reason: fmt.Sprintf("Cannot index into list with non-integer index %s", right),
-				}
+				return nil, c.err(n, "Right operand of %s must be a bool, got %s", n.op, right.String())
 			}
-
-			if listIndex < 0 || int64(listIndex) > int64(len(target)) {
-				return null, nil
+			return rightBool, nil
+		case "|>":
+			left, err := c.evalExpr(n.left, sc)
+			if err != nil {
+				return nil, err
 			}
-
-			return target[listIndex], nil
-		case ObjectValue:
-			objKey := right.String()
-
-			if val, ok := target[objKey]; ok {
-				return val, nil
+			fn, err := c.evalExpr(n.right, sc)
+			if err != nil {
+				return nil, err
 			}
-
-			return null, nil
-		}
-
-		return nil, runtimeError{
-			reason: fmt.Sprintf("Expected string, list, or object in left-hand side of property access, got %s", left.String()),
+			return c.callValue(fn, []Value{left}, n)
+		default:
+			left, err := c.evalExpr(n.left, sc)
+			if err != nil {
+				return nil, err
+			}
+			right, err := c.evalExpr(n.right, sc)
+			if err != nil {
+				return nil, err
+			}
+			result, err := binaryOp(n.op, left, right)
+			if err != nil {
+				return nil, c.err(n, "%s", err)
+			}
+			return result, nil
 		}
-	case unaryNode:
-		// TODO: implement
-		panic("unaryNode not implemented!")
-	case binaryNode:
-		// TODO: implement
-		panic("binaryNode not implemented!")
 	case fnCallNode:
 		maybeFn, err := c.evalExpr(n.fn, sc)
 		if err != nil {
@@ -522,24 +780,7 @@ func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
 			}
 		}
 
-		if fn, ok := maybeFn.(FnValue); ok {
-			// TODO: implement restArgs
-			args = args[:len(fn.defn.args)]
-			fnScope := scope{
-				parent: &fn.scope,
-				vars:   map[string]Value{},
-			}
-			for i, argName := range fn.defn.args {
-				fnScope.put(argName, args[i])
-			}
-			return c.evalExpr(fn.defn.body, fnScope)
-		} else if fn, ok := maybeFn.(BuiltinFnValue); ok {
-			return fn.fn(args)
-		} else {
-			return nil, runtimeError{
-				reason: fmt.Sprintf("%s is not a function and cannot be called", maybeFn),
-			}
-		}
+		return c.callValue(maybeFn, args, n)
 	case ifExprNode:
 		cond, err := c.evalExpr(n.cond, sc)
 		if err != nil {
@@ -576,3 +817,183 @@ func (c *Context) evalExpr(node astNode, sc scope) (Value, error) {
 	}
 	return null, nil
 }
+
+// unaryOp implements ! and - for operand type, as a plain function so both
+// evalExpr and the VM's OpUnary can share the exact same semantics - each
+// attaches its own source position to the error it returns.
+func unaryOp(op string, operand Value) (Value, error) {
+	switch op {
+	case "!":
+		b, ok := operand.(BoolValue)
+		if !ok {
+			return nil, fmt.Errorf("Cannot negate non-bool value %s with !", operand.String())
+		}
+		return !b, nil
+	case "-":
+		switch v := operand.(type) {
+		case IntValue:
+			return -v, nil
+		case FloatValue:
+			return -v, nil
+		default:
+			return nil, fmt.Errorf("Cannot negate non-numeric value %s with -", operand.String())
+		}
+	default:
+		return nil, fmt.Errorf("Unknown unary operator %s", op)
+	}
+}
+
+// binaryOp dispatches arithmetic and comparison operators (everything except
+// and/or/|>, which short-circuit or call rather than operating on two already
+// -evaluated values) by operator name and operand type, as a plain function so
+// both evalExpr and the VM's OpBinary can share the exact same semantics -
+// each attaches its own source position to the error it returns.
+func binaryOp(op string, left, right Value) (Value, error) {
+	switch op {
+	case "=":
+		return BoolValue(left.Eq(right)), nil
+	case "!=":
+		return BoolValue(!left.Eq(right)), nil
+	case "<", "<=", ">", ">=":
+		ord, err := cmp(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return BoolValue(ord < 0), nil
+		case "<=":
+			return BoolValue(ord <= 0), nil
+		case ">":
+			return BoolValue(ord > 0), nil
+		default: // ">="
+			return BoolValue(ord >= 0), nil
+		}
+	case "+":
+		switch l := left.(type) {
+		case StringValue:
+			r, ok := right.(StringValue)
+			if !ok {
+				return nil, fmt.Errorf("Cannot + a string with %s", right.String())
+			}
+			return append(append(StringValue{}, l...), r...), nil
+		case ListValue:
+			r, ok := right.(ListValue)
+			if !ok {
+				return nil, fmt.Errorf("Cannot + a list with %s", right.String())
+			}
+			return append(append(ListValue{}, l...), r...), nil
+		}
+		fallthrough
+	case "-", "*", "/", "%":
+		return numericBinary(op, left, right)
+	}
+
+	return nil, fmt.Errorf("Unknown binary operator %s", op)
+}
+
+// cmp orders two Values. For two ints, two floats or two strings, cmp(a, b)
+// == 0 exactly when a.Eq(b). An int and a float are compared by numeric
+// value, so cmp(IntValue(1), FloatValue(1)) is 0 although Eq reports them
+// unequal. Only the ordered value kinds (numbers and strings) support
+// ordering; anything else is an error rather than an arbitrary ordering.
+func cmp(a, b Value) (int, error) {
+	switch x := a.(type) {
+	case IntValue:
+		switch y := b.(type) {
+		case IntValue:
+			return compareFloat(float64(x), float64(y)), nil
+		case FloatValue:
+			return compareFloat(float64(x), float64(y)), nil
+		}
+	case FloatValue:
+		switch y := b.(type) {
+		case IntValue:
+			return compareFloat(float64(x), float64(y)), nil
+		case FloatValue:
+			return compareFloat(float64(x), float64(y)), nil
+		}
+	case StringValue:
+		if y, ok := b.(StringValue); ok {
+			return bytes.Compare(x, y), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %s and %s", a.String(), b.String())
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// numericBinary implements + - * / % for Int/Float operands with the usual
+// int-to-float promotion when the operands differ, returning a plain error
+// (the caller attaches source position) rather than panicking - including on
+// integer division/modulo by zero.
+func numericBinary(op string, left, right Value) (Value, error) {
+	li, lIsInt := left.(IntValue)
+	lf, lIsFloat := left.(FloatValue)
+	ri, rIsInt := right.(IntValue)
+	rf, rIsFloat := right.(FloatValue)
+
+	if lIsInt && rIsInt {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/":
+			if ri == 0 {
+				return nil, fmt.Errorf("integer division by zero")
+			}
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("integer division by zero")
+			}
+			return li % ri, nil
+		}
+	}
+
+	var lv, rv FloatValue
+	switch {
+	case lIsInt:
+		lv = FloatValue(li)
+	case lIsFloat:
+		lv = lf
+	default:
+		return nil, fmt.Errorf("expected a number, got %s", left.String())
+	}
+	switch {
+	case rIsInt:
+		rv = FloatValue(ri)
+	case rIsFloat:
+		rv = rf
+	default:
+		return nil, fmt.Errorf("expected a number, got %s", right.String())
+	}
+
+	switch op {
+	case "+":
+		return lv + rv, nil
+	case "-":
+		return lv - rv, nil
+	case "*":
+		return lv * rv, nil
+	case "/":
+		return lv / rv, nil
+	case "%":
+		return FloatValue(math.Mod(float64(lv), float64(rv))), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
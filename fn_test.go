@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// TestNamedFnRecursion covers a named function literal calling itself by
+// name from inside its own body, through both the tree-walking evaluator
+// and the compiler/VM pipeline (see evalBoth in operator_test.go). The
+// compiler didn't bind a function's own name anywhere, so self-recursive
+// calls through the VM would resolve to an unrelated outer symbol (or fail
+// to resolve at all) instead of the function itself.
+func TestNamedFnRecursion(t *testing.T) {
+	// fn countdown(n) = if n <= 0 { 0 -> 0, _ -> countdown(n - 1) }
+	// countdown(3)
+	countdown := fnNode{
+		name: "countdown",
+		args: []string{"n"},
+		body: ifExprNode{
+			cond: binaryNode{op: "<=", left: identifierNode{payload: "n"}, right: numberNode{isInteger: true, intPayload: 0}},
+			branches: []ifBranch{
+				{
+					target: booleanNode{payload: true},
+					body:   numberNode{isInteger: true, intPayload: 0},
+				},
+				{
+					target: booleanNode{payload: false},
+					body: fnCallNode{
+						fn: identifierNode{payload: "countdown"},
+						args: []astNode{
+							binaryNode{op: "-", left: identifierNode{payload: "n"}, right: numberNode{isInteger: true, intPayload: 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	node := blockNode{exprs: []astNode{
+		assignmentNode{left: identifierNode{payload: "countdown"}, right: countdown, isLocal: true},
+		fnCallNode{fn: identifierNode{payload: "countdown"}, args: []astNode{numberNode{isInteger: true, intPayload: 3}}},
+	}}
+
+	ast, vm, astErr, vmErr := evalBoth(t, node)
+	if astErr != nil {
+		t.Fatalf("AST eval: unexpected error: %s", astErr)
+	}
+	if vmErr != nil {
+		t.Fatalf("VM eval: unexpected error: %s", vmErr)
+	}
+
+	want := IntValue(0)
+	if !ast.Eq(want) {
+		t.Fatalf("AST eval = %s, want %s", ast.String(), want.String())
+	}
+	if !vm.Eq(want) {
+		t.Fatalf("VM eval = %s, want %s (the compiler must bind the function's own name so recursive calls resolve through the VM)", vm.String(), want.String())
+	}
+}
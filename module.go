@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ModuleGetter resolves a name used in an import expression to the Value it
+// evaluates to. When Context.Modules is nil, imports resolve to modules
+// registered with Context.RegisterModule and then, if AllowFileImport is set,
+// to files resolved against Context.Cwd; embedders can set Context.Modules to
+// serve modules from somewhere other than the filesystem.
+type ModuleGetter interface {
+	Get(name string) (Value, error)
+}
+
+// moduleRegistry is shared (by pointer) between a Context and every child
+// Context created to evaluate an imported file, so that a diamond import
+// graph evaluates each file at most once.
+type moduleRegistry struct {
+	registered map[string]Value
+	cache      map[string]Value // resolved file path -> evaluated exports
+	inProgress map[string]bool  // resolved file path -> currently being evaluated
+}
+
+func newModuleRegistry() *moduleRegistry {
+	return &moduleRegistry{
+		registered: map[string]Value{},
+		cache:      map[string]Value{},
+		inProgress: map[string]bool{},
+	}
+}
+
+// RegisterModule makes v available to import expressions under name,
+// without touching the filesystem. This is how Go-side builtins plug in as
+// named modules (e.g. import("str")).
+func (c *Context) RegisterModule(name string, v Value) {
+	c.modules.registered[name] = v
+}
+
+// resolveImport is what the import expression evaluates to, whether that's
+// a registered Go-side module or an Oak file loaded relative to Cwd.
+func (c *Context) resolveImport(name string) (Value, error) {
+	if c.Modules != nil {
+		return c.Modules.Get(name)
+	}
+
+	if v, ok := c.modules.registered[name]; ok {
+		return v, nil
+	}
+
+	if !c.AllowFileImport {
+		return nil, runtimeError{
+			reason: fmt.Sprintf("%s is not a registered module, and file imports are not allowed in this context", name),
+		}
+	}
+
+	return c.importFile(name)
+}
+
+func (c *Context) importFile(name string) (Value, error) {
+	resolved, err := c.resolveImportPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if exports, ok := c.modules.cache[resolved]; ok {
+		return exports, nil
+	}
+
+	if c.modules.inProgress[resolved] {
+		return nil, runtimeError{reason: fmt.Sprintf("cyclic import: %s is already being loaded", name)}
+	}
+	c.modules.inProgress[resolved] = true
+	defer delete(c.modules.inProgress, resolved)
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, runtimeError{reason: fmt.Sprintf("could not import %s: %s", name, err)}
+	}
+	defer file.Close()
+
+	child := NewContext(resolved, filepath.Dir(resolved))
+	child.AllowFileImport = c.AllowFileImport
+	child.ImportFileExt = c.ImportFileExt
+	child.Modules = c.Modules
+	child.modules = c.modules
+
+	// Imports are evaluated with the tree-walking evaluator rather than
+	// Eval/the VM: the VM's globals are anonymous numeric slots by the time
+	// compilation finishes, but an import needs the evaluated file's
+	// top-level bindings by name to build its exports object.
+	if _, err := child.EvalAST(file); err != nil {
+		return nil, err
+	}
+
+	exports := ObjectValue(child.scope.vars)
+	c.modules.cache[resolved] = exports
+	return exports, nil
+}
+
+// resolveImportPath resolves name against Cwd, trying each extension in
+// ImportFileExt in turn when name has no extension of its own, or has one but
+// no file exists at that exact path.
+func (c *Context) resolveImportPath(name string) (string, error) {
+	base := name
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(c.Cwd, base)
+	}
+
+	if filepath.Ext(base) != "" {
+		if _, err := os.Stat(base); err == nil {
+			return base, nil
+		}
+	}
+
+	for _, ext := range c.ImportFileExt {
+		candidate := base + ext
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", runtimeError{reason: fmt.Sprintf("could not resolve import %s against %s", name, c.Cwd)}
+}
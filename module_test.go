@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestImportExposesTopLevelBindings guards against a regression where
+// importFile read a file's exports out of child.scope.vars after running it
+// through evalProgram, which wrapped the whole file in a blockNode; the
+// blockNode case always evaluates into a brand-new child scope, so every
+// import resolved to {} no matter what the file defined. evalProgram now
+// evaluates the file's top-level exprs directly against the child Context's
+// own scope, so its bindings land in child.scope.vars as intended.
+func TestImportExposesTopLevelBindings(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mod.oak"), []byte(`message := "hello"`), 0o644); err != nil {
+		t.Fatalf("writing fixture: %s", err)
+	}
+
+	c := NewContext("<test>", dir)
+	c.AllowFileImport = true
+
+	exports, err := c.resolveImport("mod")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	obj, ok := exports.(ObjectValue)
+	if !ok {
+		t.Fatalf("exports = %T, want ObjectValue", exports)
+	}
+
+	got, ok := obj["message"]
+	if !ok {
+		t.Fatalf("exports missing %q binding; got %v", "message", obj)
+	}
+	want := StringValue([]byte("hello"))
+	if !got.Eq(want) {
+		t.Fatalf("exports[%q] = %s, want %s", "message", got.String(), want.String())
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import "testing"
+
+func TestUnaryOp(t *testing.T) {
+	cases := []struct {
+		name    string
+		op      string
+		operand Value
+		want    Value
+		wantErr bool
+	}{
+		{"not true", "!", BoolValue(true), BoolValue(false), false},
+		{"not false", "!", BoolValue(false), BoolValue(true), false},
+		{"not non-bool", "!", IntValue(1), nil, true},
+		{"negate int", "-", IntValue(5), IntValue(-5), false},
+		{"negate float", "-", FloatValue(2.5), FloatValue(-2.5), false},
+		{"negate non-numeric", "-", StringValue("x"), nil, true},
+		{"unknown operator", "~", IntValue(1), nil, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := unaryOp(tc.op, tc.operand)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("unaryOp(%q, %s) = %v, want error", tc.op, tc.operand.String(), got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unaryOp(%q, %s) returned unexpected error: %s", tc.op, tc.operand.String(), err)
+			}
+			if !got.Eq(tc.want) {
+				t.Fatalf("unaryOp(%q, %s) = %s, want %s", tc.op, tc.operand.String(), got.String(), tc.want.String())
+			}
+		})
+	}
+}
+
+func TestBinaryOp(t *testing.T) {
+	cases := []struct {
+		name        string
+		op          string
+		left, right Value
+		want        Value
+		wantErr     bool
+	}{
+		{"int + int", "+", IntValue(1), IntValue(2), IntValue(3), false},
+		{"int + float", "+", IntValue(1), FloatValue(2.5), FloatValue(3.5), false},
+		{"float + float", "+", FloatValue(1.5), FloatValue(2.5), FloatValue(4), false},
+		{"string + string", "+", StringValue("ab"), StringValue("cd"), StringValue("abcd"), false},
+		{"string + non-string", "+", StringValue("ab"), IntValue(1), nil, true},
+		{"list + list", "+", ListValue{IntValue(1)}, ListValue{IntValue(2)}, ListValue{IntValue(1), IntValue(2)}, false},
+		{"int - int", "-", IntValue(5), IntValue(3), IntValue(2), false},
+		{"int * float", "*", IntValue(2), FloatValue(1.5), FloatValue(3), false},
+		{"int / int", "/", IntValue(7), IntValue(2), IntValue(3), false},
+		{"int / int by zero", "/", IntValue(1), IntValue(0), nil, true},
+		{"int % int by zero", "%", IntValue(1), IntValue(0), nil, true},
+		{"float / float", "/", FloatValue(7), FloatValue(2), FloatValue(3.5), false},
+		{"float % float", "%", FloatValue(5), FloatValue(2), FloatValue(1), false},
+		{"numeric op on non-number", "-", StringValue("x"), IntValue(1), nil, true},
+		{"eq", "=", IntValue(1), IntValue(1), BoolValue(true), false},
+		{"neq", "!=", IntValue(1), IntValue(2), BoolValue(true), false},
+		{"lt", "<", IntValue(1), IntValue(2), BoolValue(true), false},
+		{"lte equal", "<=", IntValue(2), IntValue(2), BoolValue(true), false},
+		{"gt", ">", FloatValue(2), IntValue(1), BoolValue(true), false},
+		{"gte", ">=", IntValue(1), IntValue(2), BoolValue(false), false},
+		{"string lt", "<", StringValue("a"), StringValue("b"), BoolValue(true), false},
+		{"uncomparable", "<", IntValue(1), StringValue("a"), nil, true},
+		{"unknown operator", "^", IntValue(1), IntValue(1), nil, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := binaryOp(tc.op, tc.left, tc.right)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("binaryOp(%q, %s, %s) = %v, want error", tc.op, tc.left.String(), tc.right.String(), got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("binaryOp(%q, %s, %s) returned unexpected error: %s", tc.op, tc.left.String(), tc.right.String(), err)
+			}
+			if !got.Eq(tc.want) {
+				t.Fatalf("binaryOp(%q, %s, %s) = %s, want %s", tc.op, tc.left.String(), tc.right.String(), got.String(), tc.want.String())
+			}
+		})
+	}
+}
+
+// evalBoth runs node through both the tree-walking evaluator and the
+// compiler/VM pipeline, so a test catches either entry point drifting from
+// the other.
+func evalBoth(t *testing.T, node astNode) (ast, vm Value, astErr, vmErr error) {
+	t.Helper()
+
+	c := NewContext("<test>", ".")
+	ast, astErr = c.evalExpr(node, c.scope)
+
+	compiler := newCompiler()
+	if err := compiler.compile(node); err != nil {
+		return ast, nil, astErr, err
+	}
+	vmInstance := newVM(&c, compiler.bytecode())
+	vm, vmErr = vmInstance.run()
+
+	return ast, vm, astErr, vmErr
+}
+
+// rhsErrorsIfEvaluated is a node whose evaluation always errors, used as the
+// right operand of and/or to prove the right side was never evaluated when
+// the left operand alone determines the result.
+var rhsErrorsIfEvaluated = unaryNode{op: "-", operand: stringNode{payload: "not a number"}}
+
+func TestAndOrShortCircuit(t *testing.T) {
+	cases := []struct {
+		name string
+		node astNode
+		want BoolValue
+	}{
+		{"and short-circuits on false", binaryNode{op: "and", left: booleanNode{payload: false}, right: rhsErrorsIfEvaluated}, false},
+		{"and evaluates right when left true", binaryNode{op: "and", left: booleanNode{payload: true}, right: booleanNode{payload: false}}, false},
+		{"or short-circuits on true", binaryNode{op: "or", left: booleanNode{payload: true}, right: rhsErrorsIfEvaluated}, true},
+		{"or evaluates right when left false", binaryNode{op: "or", left: booleanNode{payload: false}, right: booleanNode{payload: true}}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ast, vm, astErr, vmErr := evalBoth(t, tc.node)
+			if astErr != nil {
+				t.Fatalf("AST eval: unexpected error: %s", astErr)
+			}
+			if vmErr != nil {
+				t.Fatalf("VM eval: unexpected error: %s", vmErr)
+			}
+			if !ast.Eq(tc.want) {
+				t.Fatalf("AST eval = %s, want %s", ast.String(), tc.want.String())
+			}
+			if !vm.Eq(tc.want) {
+				t.Fatalf("VM eval = %s, want %s", vm.String(), tc.want.String())
+			}
+		})
+	}
+
+	t.Run("and errors when left operand is non-bool", func(t *testing.T) {
+		node := binaryNode{op: "and", left: numberNode{isInteger: true, intPayload: 1}, right: booleanNode{payload: true}}
+		_, _, astErr, vmErr := evalBoth(t, node)
+		if astErr == nil {
+			t.Fatal("AST eval: expected error for non-bool left operand")
+		}
+		if vmErr == nil {
+			t.Fatal("VM eval: expected error for non-bool left operand")
+		}
+	})
+
+	t.Run("or errors when right operand is non-bool", func(t *testing.T) {
+		node := binaryNode{op: "or", left: booleanNode{payload: false}, right: numberNode{isInteger: true, intPayload: 1}}
+		_, _, astErr, vmErr := evalBoth(t, node)
+		if astErr == nil {
+			t.Fatal("AST eval: expected error for non-bool right operand")
+		}
+		if vmErr == nil {
+			t.Fatal("VM eval: expected error for non-bool right operand")
+		}
+	})
+}
+
+func TestIfExprBranchSelection(t *testing.T) {
+	// if 2 { 1 -> "one", 2 -> "two", 3 -> "three" }
+	node := ifExprNode{
+		cond: numberNode{isInteger: true, intPayload: 2},
+		branches: []ifBranch{
+			{target: numberNode{isInteger: true, intPayload: 1}, body: stringNode{payload: "one"}},
+			{target: numberNode{isInteger: true, intPayload: 2}, body: stringNode{payload: "two"}},
+			{target: numberNode{isInteger: true, intPayload: 3}, body: stringNode{payload: "three"}},
+		},
+	}
+
+	ast, vm, astErr, vmErr := evalBoth(t, node)
+	if astErr != nil {
+		t.Fatalf("AST eval: unexpected error: %s", astErr)
+	}
+	if vmErr != nil {
+		t.Fatalf("VM eval: unexpected error: %s", vmErr)
+	}
+
+	want := StringValue("two")
+	if !ast.Eq(want) {
+		t.Fatalf("AST eval selected %s, want %s", ast.String(), want.String())
+	}
+	if !vm.Eq(want) {
+		t.Fatalf("VM eval selected %s, want %s (compiler must compare cond against each branch target, not just use the target's raw value)", vm.String(), want.String())
+	}
+}
+
+func TestIfExprNoBranchMatches(t *testing.T) {
+	node := ifExprNode{
+		cond: numberNode{isInteger: true, intPayload: 99},
+		branches: []ifBranch{
+			{target: numberNode{isInteger: true, intPayload: 1}, body: stringNode{payload: "one"}},
+		},
+	}
+
+	ast, vm, astErr, vmErr := evalBoth(t, node)
+	if astErr != nil {
+		t.Fatalf("AST eval: unexpected error: %s", astErr)
+	}
+	if vmErr != nil {
+		t.Fatalf("VM eval: unexpected error: %s", vmErr)
+	}
+	if ast != null {
+		t.Fatalf("AST eval = %s, want null", ast.String())
+	}
+	if vm != null {
+		t.Fatalf("VM eval = %s, want null", vm.String())
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPipelineEvaluatesLeftBeforeRight pipes a freshly-defined binding into
+// an expression that reads that same binding: `seen := true |> seen`. Both
+// backends should evaluate the piped value (left) before the callee
+// (right), so "seen" already exists by the time right runs and the call
+// fails because a bool isn't callable - not because "seen" is undefined.
+// The compiler previously compiled right before left, so the VM took this
+// same program down the "undefined" path instead.
+func TestPipelineEvaluatesLeftBeforeRight(t *testing.T) {
+	node := blockNode{exprs: []astNode{
+		binaryNode{
+			op:    "|>",
+			left:  assignLocal(ident("seen"), booleanNode{payload: true}),
+			right: ident("seen"),
+		},
+	}}
+
+	_, _, astErr, vmErr := evalBoth(t, node)
+
+	if astErr == nil || !strings.Contains(astErr.Error(), "is not a function") {
+		t.Fatalf("AST eval error = %v, want an 'is not a function' error", astErr)
+	}
+	if vmErr == nil || !strings.Contains(vmErr.Error(), "is not a function") {
+		t.Fatalf("VM eval error = %v, want an 'is not a function' error (left must compile before right)", vmErr)
+	}
+}
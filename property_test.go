@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+// TestPropertyAccessRead covers the propertyAccessNode read path, which used
+// to duplicate getProperty's bounds check with an off-by-one (`>` instead of
+// `>=`) instead of actually calling it despite the comment claiming it did:
+// reading index == len(target) fell through to the indexing expression
+// itself and panicked rather than returning null like every other
+// out-of-range read.
+func TestPropertyAccessRead(t *testing.T) {
+	t.Run("list index in range", func(t *testing.T) {
+		got, err := runAST(t,
+			assignLocal(ident("lst"), listNode{elems: []astNode{num(1), num(2)}}),
+			propertyAccessNode{left: ident("lst"), right: num(1)},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if want := IntValue(2); !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("list index at length returns null", func(t *testing.T) {
+		got, err := runAST(t,
+			assignLocal(ident("lst"), listNode{elems: []astNode{num(1), num(2)}}),
+			propertyAccessNode{left: ident("lst"), right: num(2)},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !got.Eq(null) {
+			t.Fatalf("got %s, want null", got.String())
+		}
+	})
+
+	t.Run("string index at length returns null", func(t *testing.T) {
+		got, err := runAST(t,
+			assignLocal(ident("s"), str("ab")),
+			propertyAccessNode{left: ident("s"), right: num(2)},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !got.Eq(null) {
+			t.Fatalf("got %s, want null", got.String())
+		}
+	})
+
+	t.Run("object key lookup", func(t *testing.T) {
+		got, err := runAST(t,
+			assignLocal(ident("obj"), objectNode{entries: []objectEntry{{key: ident("a"), val: num(1)}}}),
+			propertyAccessNode{left: ident("obj"), right: str("a")},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if want := IntValue(1); !got.Eq(want) {
+			t.Fatalf("got %s, want %s", got.String(), want.String())
+		}
+	})
+}
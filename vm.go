@@ -0,0 +1,548 @@
+package main
+
+import "fmt"
+
+const (
+	stackSize  = 2048
+	globalSize = 65536
+
+	// initialFrameCapacity is how many frames newVM preallocates up front as
+	// a perf hint; pushFrame grows frames beyond that via append. The actual
+	// call depth bound is ctx.MaxStackDepth (see pushFrame), the same field
+	// callValue honors for the tree-walking evaluator.
+	initialFrameCapacity = 1024
+)
+
+// CompiledFunction is the constant-pool representation of a fnNode once the
+// Compiler has lowered its body to bytecode. defn is kept around for String()
+// and for stack-trace naming; Instructions/NumLocals/NumParams are what the
+// VM actually needs to run it.
+type CompiledFunction struct {
+	defn         *fnNode
+	Instructions Instructions
+	NumLocals    int
+	NumParams    int
+}
+
+func (v CompiledFunction) String() string {
+	return v.defn.String()
+}
+func (v CompiledFunction) Eq(u Value) bool {
+	if w, ok := u.(CompiledFunction); ok {
+		return v.defn == w.defn
+	}
+	return false
+}
+
+// vmClosure pairs a CompiledFunction with the free variables it captured at
+// the point the OpClosure instruction ran, the VM's equivalent of the
+// parent-scope pointer embedded in a tree-walking FnValue.
+type vmClosure struct {
+	fn   CompiledFunction
+	free []Value
+}
+
+func (v vmClosure) String() string {
+	return v.fn.String()
+}
+func (v vmClosure) Eq(u Value) bool {
+	if w, ok := u.(vmClosure); ok {
+		return v.fn.Eq(w.fn)
+	}
+	return false
+}
+
+// Frame is one call's worth of VM state: which closure is running, where its
+// instruction pointer is, and where its locals start on the value stack.
+type Frame struct {
+	cl          vmClosure
+	ip          int
+	basePointer int
+
+	// pushedCallStack records whether entering this frame pushed a
+	// stackEntry onto vm.callStack, so OpReturn knows whether to pop one.
+	pushedCallStack bool
+}
+
+func (f *Frame) Instructions() Instructions {
+	return f.cl.fn.Instructions
+}
+
+// VM executes a compiled Bytecode program against a value stack and a frame
+// stack, in place of the recursive evalExpr tree-walk.
+type VM struct {
+	ctx *Context
+
+	constants []Value
+	sourceMap map[int]pos
+
+	stack []Value
+	sp    int
+
+	globals []Value
+
+	frames      []*Frame
+	framesIndex int
+
+	// callStack mirrors Context.callStack for the VM: one stackEntry per
+	// vmClosure call currently on the frame stack, so runtime errors raised
+	// while executing through Eval()/the VM get a real trace too.
+	callStack *stackEntry
+}
+
+func newVM(ctx *Context, bc Bytecode) *VM {
+	mainFn := CompiledFunction{Instructions: bc.Instructions}
+	mainFrame := &Frame{cl: vmClosure{fn: mainFn}}
+
+	frames := make([]*Frame, 1, initialFrameCapacity)
+	frames[0] = mainFrame
+
+	return &VM{
+		ctx:         ctx,
+		constants:   bc.Constants,
+		sourceMap:   bc.SourceMap,
+		stack:       make([]Value, stackSize),
+		globals:     make([]Value, globalSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame enforces ctx.MaxStackDepth the same way callValue does for the
+// tree-walking evaluator: a depth <= 0 means no configured limit. The main
+// frame isn't a call, so it doesn't count toward the limit.
+func (vm *VM) pushFrame(f *Frame) error {
+	if limit := vm.ctx.MaxStackDepth; limit > 0 && vm.framesIndex > limit {
+		return vm.errAt(f.ip, "maximum call stack size (%d) exceeded", limit)
+	}
+	if vm.framesIndex < len(vm.frames) {
+		vm.frames[vm.framesIndex] = f
+	} else {
+		vm.frames = append(vm.frames, f)
+	}
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(v Value) error {
+	if vm.sp >= stackSize {
+		return vmError{reason: "stack overflow"}
+	}
+	vm.stack[vm.sp] = v
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() Value {
+	v := vm.stack[vm.sp-1]
+	vm.sp--
+	return v
+}
+
+func (vm *VM) top() Value {
+	if vm.sp == 0 {
+		return null
+	}
+	return vm.stack[vm.sp-1]
+}
+
+// errAt builds a runtimeError at the source position the compiler recorded
+// for ip, chained onto whatever VM call stack is active, the VM's
+// equivalent of Context.err for the tree-walking evaluator.
+func (vm *VM) errAt(ip int, format string, args ...interface{}) error {
+	return runtimeError{
+		reason:     fmt.Sprintf(format, args...),
+		sourcePath: vm.ctx.SourcePath,
+		stackTrace: stackEntry{pos: vm.sourceMap[ip], parentStack: vm.callStack},
+	}
+}
+
+// wrapErr attaches the VM's source position and call stack to an error
+// that was raised without access to either (e.g. getProperty, or a
+// runtimeError surfaced from an import), leaving any other error untouched.
+func (vm *VM) wrapErr(ip int, err error) error {
+	re, ok := err.(runtimeError)
+	if !ok {
+		return err
+	}
+	re.sourcePath = vm.ctx.SourcePath
+	re.stackTrace = stackEntry{pos: vm.sourceMap[ip], parentStack: vm.callStack}
+	return re
+}
+
+// run executes instructions until the outermost frame runs past the end of
+// its instructions, and returns whatever value was left on top of the stack.
+func (vm *VM) run() (Value, error) {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions()) {
+		frame := vm.currentFrame()
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := Op(ins[ip])
+
+		switch op {
+		case OpConstant:
+			idx := readUint16(ins, ip+1)
+			frame.ip += 3
+			if err := vm.push(vm.constants[idx]); err != nil {
+				return nil, err
+			}
+		case OpNull:
+			frame.ip++
+			if err := vm.push(null); err != nil {
+				return nil, err
+			}
+		case OpPop:
+			frame.ip++
+			vm.pop()
+		case OpDup:
+			frame.ip++
+			if err := vm.push(vm.top()); err != nil {
+				return nil, err
+			}
+		case OpSwap:
+			frame.ip++
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+		case OpGetLocal:
+			localIdx := readUint8(ins, ip+1)
+			frame.ip += 2
+			if err := vm.push(vm.stack[frame.basePointer+localIdx]); err != nil {
+				return nil, err
+			}
+		case OpSetLocal:
+			localIdx := readUint8(ins, ip+1)
+			frame.ip += 2
+			vm.stack[frame.basePointer+localIdx] = vm.top()
+		case OpGetGlobal:
+			idx := readUint16(ins, ip+1)
+			frame.ip += 3
+			if err := vm.push(vm.globals[idx]); err != nil {
+				return nil, err
+			}
+		case OpSetGlobal:
+			idx := readUint16(ins, ip+1)
+			frame.ip += 3
+			vm.globals[idx] = vm.top()
+		case OpGetFree:
+			freeIdx := readUint8(ins, ip+1)
+			frame.ip += 2
+			if err := vm.push(frame.cl.free[freeIdx]); err != nil {
+				return nil, err
+			}
+		case OpMakeList:
+			n := readUint16(ins, ip+1)
+			frame.ip += 3
+			elems := make([]Value, n)
+			copy(elems, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			if err := vm.push(ListValue(elems)); err != nil {
+				return nil, err
+			}
+		case OpMakeObject:
+			n := readUint16(ins, ip+1)
+			frame.ip += 3
+			obj := ObjectValue{}
+			start := vm.sp - n*2
+			for i := 0; i < n; i++ {
+				key := vm.stack[start+i*2]
+				val := vm.stack[start+i*2+1]
+				objKey := key.String()
+				if s, ok := key.(StringValue); ok {
+					objKey = string(s)
+				}
+				obj[objKey] = val
+			}
+			vm.sp = start
+			if err := vm.push(obj); err != nil {
+				return nil, err
+			}
+		case OpGetProp:
+			frame.ip++
+			key := vm.pop()
+			target := vm.pop()
+			val, err := getProperty(target, key)
+			if err != nil {
+				return nil, vm.wrapErr(ip, err)
+			}
+			if err := vm.push(val); err != nil {
+				return nil, err
+			}
+		case OpSetProp:
+			frame.ip++
+			value := vm.pop()
+			key := vm.pop()
+			target := vm.pop()
+			if err := setProperty(target, key, value); err != nil {
+				return nil, vm.wrapErr(ip, err)
+			}
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+		case OpAssertType:
+			tag := readUint8(ins, ip+1)
+			frame.ip += 2
+			val := vm.top()
+			switch byte(tag) {
+			case listTypeTag:
+				if _, ok := val.(ListValue); !ok {
+					return nil, vm.errAt(ip, "Expected a list on the right-hand side of list destructuring, got %s", val.String())
+				}
+			case objectTypeTag:
+				if _, ok := val.(ObjectValue); !ok {
+					return nil, vm.errAt(ip, "Expected an object on the right-hand side of object destructuring, got %s", val.String())
+				}
+			}
+		case OpListTail:
+			start := readUint16(ins, ip+1)
+			frame.ip += 3
+			val := vm.pop()
+			listVal, ok := val.(ListValue)
+			if !ok {
+				return nil, vm.errAt(ip, "Expected a list on the right-hand side of list destructuring, got %s", val.String())
+			}
+			rest := ListValue{}
+			if start < len(listVal) {
+				rest = append(rest, listVal[start:]...)
+			}
+			if err := vm.push(rest); err != nil {
+				return nil, err
+			}
+		case OpAssert:
+			idx := readUint16(ins, ip+1)
+			frame.ip += 3
+			cond := vm.pop()
+			b, ok := cond.(BoolValue)
+			if !ok {
+				return nil, vm.errAt(ip, "Expected a bool, got %s", cond.String())
+			}
+			if !bool(b) {
+				msg := vm.constants[idx].(StringValue)
+				return nil, vm.errAt(ip, "%s", string(msg))
+			}
+		case OpJump:
+			target := readUint16(ins, ip+1)
+			frame.ip = target
+		case OpJumpIfFalse:
+			target := readUint16(ins, ip+1)
+			frame.ip += 3
+			cond := vm.pop()
+			b, ok := cond.(BoolValue)
+			if !ok {
+				return nil, vm.errAt(ip, "Expected a bool, got %s", cond.String())
+			}
+			if !bool(b) {
+				frame.ip = target
+			}
+		case OpClosure:
+			constIdx := readUint16(ins, ip+1)
+			numFree := readUint8(ins, ip+3)
+			frame.ip += 4
+
+			fn, ok := vm.constants[constIdx].(CompiledFunction)
+			if !ok {
+				return nil, vm.errAt(ip, "%s is not a compiled function", vm.constants[constIdx])
+			}
+
+			free := make([]Value, numFree)
+			copy(free, vm.stack[vm.sp-numFree:vm.sp])
+			vm.sp -= numFree
+
+			if err := vm.push(vmClosure{fn: fn, free: free}); err != nil {
+				return nil, err
+			}
+		case OpCall:
+			numArgs := readUint8(ins, ip+1)
+			frame.ip += 2
+
+			if err := vm.call(ip, numArgs); err != nil {
+				return nil, vm.wrapErr(ip, err)
+			}
+		case OpReturn:
+			returnVal := vm.pop()
+			returningFrame := vm.popFrame()
+			vm.sp = returningFrame.basePointer - 1
+			if returningFrame.pushedCallStack {
+				vm.callStack = vm.callStack.parentStack
+			}
+			if err := vm.push(returnVal); err != nil {
+				return nil, err
+			}
+		case OpImport:
+			idx := readUint16(ins, ip+1)
+			frame.ip += 3
+			name := vm.constants[idx].(StringValue)
+			val, err := vm.ctx.resolveImport(string(name))
+			if err != nil {
+				return nil, vm.wrapErr(ip, err)
+			}
+			if err := vm.push(val); err != nil {
+				return nil, err
+			}
+		case OpUnary:
+			code := readUint8(ins, ip+1)
+			frame.ip += 2
+			operand := vm.pop()
+			result, err := unaryOp(unaryOpNames[code], operand)
+			if err != nil {
+				return nil, vm.errAt(ip, "%s", err)
+			}
+			if err := vm.push(result); err != nil {
+				return nil, err
+			}
+		case OpBinary:
+			code := readUint8(ins, ip+1)
+			frame.ip += 2
+			right := vm.pop()
+			left := vm.pop()
+			result, err := binaryOp(binaryOpNames[code], left, right)
+			if err != nil {
+				return nil, vm.errAt(ip, "%s", err)
+			}
+			if err := vm.push(result); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, vm.errAt(ip, "unknown opcode %s", op)
+		}
+	}
+
+	return vm.top(), nil
+}
+
+func (vm *VM) call(callerIP, numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch fn := callee.(type) {
+	case vmClosure:
+		if numArgs != fn.fn.NumParams {
+			return runtimeError{reason: fmt.Sprintf("expected %d arguments, got %d", fn.fn.NumParams, numArgs)}
+		}
+
+		f := &Frame{cl: fn, basePointer: vm.sp - numArgs, pushedCallStack: true}
+		vm.sp = f.basePointer + fn.fn.NumLocals
+		if fn.fn.defn != nil && fn.fn.defn.name != "" {
+			// the compiler reserved the local slot right after the
+			// parameters for the function's own name; seed it with the
+			// closure being called so a recursive call can resolve it.
+			vm.stack[f.basePointer+fn.fn.NumParams] = fn
+		}
+		if err := vm.pushFrame(f); err != nil {
+			return err
+		}
+
+		vm.callStack = &stackEntry{fnName: fn.fn.defn.name, pos: vm.sourceMap[callerIP], parentStack: vm.callStack}
+		return nil
+	case BuiltinFnValue:
+		args := make([]Value, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+		result, err := fn.fn(args)
+		if err != nil {
+			return err
+		}
+
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(result)
+	default:
+		return runtimeError{reason: fmt.Sprintf("%s is not a function and cannot be called", callee)}
+	}
+}
+
+// getProperty implements the shared, direction-agnostic half of
+// propertyAccessNode handling used by both evalExpr and the VM's OpGetProp.
+func getProperty(target, key Value) (Value, error) {
+	switch t := target.(type) {
+	case StringValue:
+		byteIndex, ok := key.(IntValue)
+		if !ok {
+			return nil, runtimeError{reason: fmt.Sprintf("Cannot index into string with non-integer index %s", key)}
+		}
+		if byteIndex < 0 || int64(byteIndex) >= int64(len(t)) {
+			return null, nil
+		}
+		return StringValue([]byte{t[byteIndex]}), nil
+	case ListValue:
+		listIndex, ok := key.(IntValue)
+		if !ok {
+			return nil, runtimeError{reason: fmt.Sprintf("Cannot index into list with non-integer index %s", key)}
+		}
+		if listIndex < 0 || int64(listIndex) >= int64(len(t)) {
+			return null, nil
+		}
+		return t[listIndex], nil
+	case ObjectValue:
+		objKey := key.String()
+		if s, ok := key.(StringValue); ok {
+			objKey = string(s)
+		}
+		if val, ok := t[objKey]; ok {
+			return val, nil
+		}
+		return null, nil
+	}
+
+	return nil, runtimeError{reason: fmt.Sprintf("Expected string, list, or object in left-hand side of property access, got %s", target.String())}
+}
+
+// setProperty implements the shared, direction-agnostic half of property
+// assignment (`obj.k := v`, `lst.i := v`) used by both evalExpr and the VM's
+// OpSetProp.
+func setProperty(target, key, value Value) error {
+	switch t := target.(type) {
+	case ObjectValue:
+		objKey := key.String()
+		if s, ok := key.(StringValue); ok {
+			objKey = string(s)
+		}
+		t[objKey] = value
+		return nil
+	case ListValue:
+		idx, ok := key.(IntValue)
+		if !ok {
+			return runtimeError{reason: fmt.Sprintf("Cannot index into list with non-integer index %s", key)}
+		}
+		if idx < 0 || int64(idx) >= int64(len(t)) {
+			return runtimeError{reason: fmt.Sprintf("List index %s out of range (length %d)", idx, len(t))}
+		}
+		t[idx] = value
+		return nil
+	case StringValue:
+		idx, ok := key.(IntValue)
+		if !ok {
+			return runtimeError{reason: fmt.Sprintf("Cannot index into string with non-integer index %s", key)}
+		}
+		if idx < 0 || int64(idx) >= int64(len(t)) {
+			return runtimeError{reason: fmt.Sprintf("String index %s out of range (length %d)", idx, len(t))}
+		}
+		b, ok := value.(StringValue)
+		if !ok || len(b) != 1 {
+			return runtimeError{reason: fmt.Sprintf("Expected a single-byte string to assign into a string index, got %s", value.String())}
+		}
+		t[idx] = b[0]
+		return nil
+	}
+
+	return runtimeError{reason: fmt.Sprintf("Expected object, list, or string in left-hand side of property assignment, got %s", target.String())}
+}
+
+// EvalBytecode compiles nodes and runs them on the VM. It's Context.Eval
+// without the parsing step, for callers that already hold parsed nodes.
+func (c *Context) EvalBytecode(nodes []astNode) (Value, error) {
+	programBlock := blockNode{exprs: nodes}
+
+	compiler := newCompiler()
+	if err := compiler.compile(programBlock); err != nil {
+		return nil, err
+	}
+
+	vm := newVM(c, compiler.bytecode())
+	return vm.run()
+}
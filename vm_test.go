@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+// TestMaxStackDepthThroughVM covers Context.MaxStackDepth bounding recursion
+// depth on the compiler/VM pipeline, not just callValue's tree-walking path:
+// vm.go previously enforced a hardcoded 1024-frame maxFrames constant that
+// ignored the field entirely, so setting MaxStackDepth to sandbox a script
+// run through Context.Eval had no effect.
+func TestMaxStackDepthThroughVM(t *testing.T) {
+	// fn recurse(n) = recurse(n + 1)
+	// recurse(0)
+	recurse := fnNode{
+		name: "recurse",
+		args: []string{"n"},
+		body: fnCallNode{
+			fn: identifierNode{payload: "recurse"},
+			args: []astNode{
+				binaryNode{op: "+", left: identifierNode{payload: "n"}, right: numberNode{isInteger: true, intPayload: 1}},
+			},
+		},
+	}
+	node := blockNode{exprs: []astNode{
+		assignmentNode{left: identifierNode{payload: "recurse"}, right: recurse, isLocal: true},
+		fnCallNode{fn: identifierNode{payload: "recurse"}, args: []astNode{numberNode{isInteger: true, intPayload: 0}}},
+	}}
+
+	c := NewContext("<test>", ".")
+	c.MaxStackDepth = 10
+
+	compiler := newCompiler()
+	if err := compiler.compile(node); err != nil {
+		t.Fatalf("compile: unexpected error: %s", err)
+	}
+
+	vm := newVM(&c, compiler.bytecode())
+	_, err := vm.run()
+	if err == nil {
+		t.Fatal("expected a stack depth error, got none")
+	}
+}